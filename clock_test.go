@@ -0,0 +1,90 @@
+package repeater_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixermark/repeater"
+	"github.com/fixermark/repeater/testclock"
+)
+
+// TestRespectsBackoffLogic closes the long-standing TODO: it exercises the
+// repeater's backoff against a FakeClock, so it can assert on the exact
+// delay sequence requested instead of waiting through real sleeps.
+func TestRespectsBackoffLogic(t *testing.T) {
+	clock := testclock.NewFakeClock(time.Unix(0, 0))
+	r := repeater.NewRepeaterWithOptions(
+		100*time.Millisecond, 5*time.Second, time.Duration(0), 2.0, 10,
+		repeater.WithClock(clock))
+
+	loop := 0
+	err := r.Repeat(func() error {
+		loop += 1
+		if loop != 7 {
+			return errors.New("Not ready to break yet.")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected nil error; was %v", err)
+	}
+
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		1600 * time.Millisecond,
+		3200 * time.Millisecond,
+	}
+	got := clock.Delays()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d delays, saw %d: %v", len(want), len(got), got)
+	}
+	for i, d := range want {
+		if got[i] != d {
+			t.Errorf("delay %d: expected %v, saw %v", i, d, got[i])
+		}
+	}
+}
+
+// TestNewRepeaterFromDriverAcceptsOptions exercises a custom BackoffDriver
+// against a FakeClock, confirming NewRepeaterFromDriver can be combined
+// with WithClock (and WithOnRetry) like the other constructors.
+func TestNewRepeaterFromDriverAcceptsOptions(t *testing.T) {
+	clock := testclock.NewFakeClock(time.Unix(0, 0))
+	var notified []time.Duration
+	r := repeater.NewRepeaterFromDriver(
+		&repeater.LinearDriver{Initial: 100 * time.Millisecond, Increment: 50 * time.Millisecond},
+		time.Second, 5,
+		repeater.WithClock(clock),
+		repeater.WithOnRetry(func(attempt int, err error, nextDelay time.Duration) {
+			notified = append(notified, nextDelay)
+		}))
+
+	loop := 0
+	err := r.Repeat(func() error {
+		loop += 1
+		if loop != 3 {
+			return errors.New("Not ready to break yet.")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected nil error; was %v", err)
+	}
+
+	want := []time.Duration{100 * time.Millisecond, 150 * time.Millisecond}
+	if len(notified) != len(want) {
+		t.Fatalf("Expected %d notifications, saw %d: %v", len(want), len(notified), notified)
+	}
+	for i, d := range want {
+		if notified[i] != d {
+			t.Errorf("notification %d: expected %v, saw %v", i, d, notified[i])
+		}
+	}
+	if got := clock.Delays(); len(got) != len(want) {
+		t.Errorf("Expected %d recorded delays, saw %d: %v", len(want), len(got), got)
+	}
+}
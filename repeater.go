@@ -4,20 +4,60 @@
 package repeater
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
+	"math/rand"
+	"sync"
 	"time"
 )
 
+// A jitter strategy applied to the computed backoff delay, to keep many
+// clients retrying a shared dependency from waking up in lockstep. See
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+type Jitter int
+
+const (
+	// No jitter; use the computed delay as-is.
+	JitterNone Jitter = iota
+	// Pick uniformly between 0 and the computed delay.
+	JitterFull
+	// Pick uniformly between half the computed delay and the full
+	// computed delay.
+	JitterEqual
+	// Ignore the computed delay entirely and instead pick uniformly
+	// between the initial delay and three times the previous delay,
+	// capped at the maximum delay (the AWS "decorrelated jitter"
+	// recurrence).
+	JitterDecorrelated
+)
+
 // A repeatable function. If the function returns an error and the retry
 // thresholds are not exceeded, it will be tried again.
 type Repeatable func() error
 
+// A repeatable function that observes the context passed to RepeatContextFunc.
+// Implementations should return promptly once ctx is done, since the
+// repeater still waits for the in-flight call to return before honoring
+// cancellation.
+type RepeatableCtx func(context.Context) error
+
 // A repeater, encapsulating the logic for retrying a Repeatable operation.
 type Repeater interface {
 	// Execute Repeatable, and if it returns a non-nil error, repeat
 	// execution. If the threshold of repetitions is exceeded, Repeat
 	// returns the last error sent.
 	Repeat(r Repeatable) error
+
+	// Like Repeat, but the retry loop is bound to ctx: if ctx is
+	// cancelled or its deadline is exceeded while waiting between
+	// attempts, RepeatContext returns immediately with an error that
+	// wraps ctx.Err() and reports the last error seen from r.
+	RepeatContext(ctx context.Context, r Repeatable) error
+
+	// Like RepeatContext, but r itself observes ctx.
+	RepeatContextFunc(ctx context.Context, r RepeatableCtx) error
 }
 
 type repeaterImpl struct {
@@ -27,6 +67,253 @@ type repeaterImpl struct {
 	exponentialGrowth float64
 	// If 0, retry indefinitely
 	maxRetries int
+	// If non-nil, consulted after every failed attempt; returning false
+	// stops retrying immediately. Permanent and Retryable override this
+	// predicate in either direction.
+	retryIf func(error) bool
+	jitter  Jitter
+	rngMu   sync.Mutex
+	rng     *rand.Rand
+	// If non-nil, delays are computed by driver instead of by
+	// increaseDelay; see NewRepeaterFromDriver.
+	driver BackoffDriver
+	// If non-nil, called after every failed attempt and before sleeping
+	// for the next retry, with the 1-indexed count of failures so far
+	// and the delay about to be waited. Never called for an attempt that
+	// won't be retried (e.g. because classify stops the loop).
+	onRetry func(attempt int, err error, nextDelay time.Duration)
+	// If non-nil, used in place of the real wall clock to wait out
+	// backoff delays; see WithClock.
+	clock Clock
+}
+
+// A Clock abstracts time so a Repeater's backoff waits can be driven by a
+// fake clock in tests instead of the real wall clock. See the testclock
+// subpackage for such a fake.
+type Clock interface {
+	Now() time.Time
+	Sleep(time.Duration)
+	NewTimer(time.Duration) Timer
+}
+
+// A Timer abstracts a single pending timer event, as returned by
+// Clock.NewTimer.
+type Timer interface {
+	// C returns the channel on which the timer delivers its firing time.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing, as (*time.Timer).Stop does.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t *realTimer) Stop() bool { return t.t.Stop() }
+
+// An Option configures a Repeater constructed via NewRepeaterWithOptions.
+type Option func(*repeaterImpl)
+
+// WithRetryIf sets the RetryIf predicate described in
+// NewRepeaterWithRetryIf.
+func WithRetryIf(retryIf func(error) bool) Option {
+	return func(r *repeaterImpl) {
+		r.retryIf = retryIf
+	}
+}
+
+// WithJitter sets the jitter strategy described in NewRepeaterWithJitter.
+// NewRepeaterWithOptions seeds a per-instance *rand.Rand automatically
+// when jitter is enabled this way and no WithRand option is given; pass
+// WithRand for deterministic tests.
+func WithJitter(jitter Jitter) Option {
+	return func(r *repeaterImpl) {
+		r.jitter = jitter
+	}
+}
+
+// WithRand sets the *rand.Rand used to compute jittered delays, in place
+// of the repeater's own freshly-seeded one. Useful in tests that need
+// deterministic jittered delays.
+func WithRand(rng *rand.Rand) Option {
+	return func(r *repeaterImpl) {
+		r.rng = rng
+	}
+}
+
+// WithOnRetry sets a callback invoked after every failed attempt and
+// before sleeping for the next retry, so callers can log, increment
+// metrics, or feed a trace without wrapping their Repeatable in
+// bookkeeping code.
+func WithOnRetry(onRetry func(attempt int, err error, nextDelay time.Duration)) Option {
+	return func(r *repeaterImpl) {
+		r.onRetry = onRetry
+	}
+}
+
+// WithClock sets the Clock used to wait out backoff delays, in place of
+// the real wall clock. See the testclock subpackage for a deterministic
+// fake suited to tests.
+func WithClock(clock Clock) Option {
+	return func(r *repeaterImpl) {
+		r.clock = clock
+	}
+}
+
+// Get a repeater with the specified initial retry delay, maximum retry
+// delay, and max retries (see NewRepeater), configured by opts. This is
+// the preferred way to combine RetryIf, Jitter, a custom Rand, and
+// OnRetry, since the number of positional constructors needed to cover
+// every combination grows with the number of features.
+//
+// If WithJitter is used without a paired WithRand, the repeater seeds its
+// own *rand.Rand from the current time, exactly as NewRepeaterWithJitter
+// does, so concurrent Repeat calls still avoid the global math/rand lock.
+func NewRepeaterWithOptions(
+	initial time.Duration,
+	max time.Duration,
+	linear time.Duration,
+	exponential float64,
+	maxRetries int,
+	opts ...Option) Repeater {
+	r := &repeaterImpl{
+		initialRepeatTime: initial,
+		maxRepeatTime:     max,
+		linearGrowth:      linear,
+		exponentialGrowth: exponential,
+		maxRetries:        maxRetries,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.jitter != JitterNone && r.rng == nil {
+		r.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return r
+}
+
+// notifyRetry invokes onRetry, if set.
+func (r *repeaterImpl) notifyRetry(attempt int, err error, nextDelay time.Duration) {
+	if r.onRetry != nil {
+		r.onRetry(attempt, err, nextDelay)
+	}
+}
+
+// A BackoffDriver computes the delay to wait before each retry attempt,
+// independent of the Repeater's own bookkeeping. attempt is 1 for the
+// delay before the second call to the Repeatable, 2 for the delay before
+// the third, and so on; prev is the delay actually waited before the
+// previous attempt, i.e. what Next returned after capping at the
+// Repeater's maximum delay (0 before the first retry), for drivers whose
+// growth depends on the prior value rather than purely on the attempt
+// number.
+//
+// A Repeater calls Reset before the first attempt of every Repeat call,
+// so stateful drivers (e.g. FibonacciDriver) start from the same place
+// each time. Because a BackoffDriver is shared by a Repeater across
+// calls, a driver with internal state is not safe to drive concurrently
+// from multiple in-flight Repeat calls on the same Repeater.
+type BackoffDriver interface {
+	Next(attempt int, prev time.Duration) time.Duration
+	Reset()
+}
+
+// ConstantDriver always returns the same delay.
+type ConstantDriver struct {
+	Delay time.Duration
+}
+
+func (d *ConstantDriver) Next(attempt int, prev time.Duration) time.Duration {
+	return d.Delay
+}
+
+func (d *ConstantDriver) Reset() {}
+
+// LinearDriver grows the delay by a fixed increment each attempt, capped
+// at Max (if Max is non-zero).
+type LinearDriver struct {
+	Initial   time.Duration
+	Increment time.Duration
+	Max       time.Duration
+}
+
+func (d *LinearDriver) Next(attempt int, prev time.Duration) time.Duration {
+	next := d.Initial + time.Duration(attempt-1)*d.Increment
+	if d.Max != 0 && next > d.Max {
+		return d.Max
+	}
+	return next
+}
+
+func (d *LinearDriver) Reset() {}
+
+// ExponentialDriver grows the delay as Growth*(prev+Linear) each attempt,
+// starting from Initial, capped at Max (if Max is non-zero). This is the
+// same growth curve NewRepeater has always used.
+type ExponentialDriver struct {
+	Initial time.Duration
+	Linear  time.Duration
+	Growth  float64
+	Max     time.Duration
+}
+
+func (d *ExponentialDriver) Next(attempt int, prev time.Duration) time.Duration {
+	var next time.Duration
+	if attempt <= 1 {
+		next = d.Initial
+	} else {
+		next = time.Duration(d.Growth * float64(prev+d.Linear))
+	}
+	if d.Max != 0 && next > d.Max {
+		return d.Max
+	}
+	return next
+}
+
+func (d *ExponentialDriver) Reset() {}
+
+// FibonacciDriver grows the delay along the Fibonacci sequence scaled by
+// Initial (Initial, Initial, 2*Initial, 3*Initial, 5*Initial, ...), capped
+// at Max (if Max is non-zero). This grows more gently than exponential
+// backoff but faster than linear.
+type FibonacciDriver struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	mu   sync.Mutex
+	a, b time.Duration
+}
+
+func (d *FibonacciDriver) Next(attempt int, prev time.Duration) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.a == 0 && d.b == 0 {
+		d.a, d.b = d.Initial, d.Initial
+	}
+	next := d.a
+	d.a, d.b = d.b, d.a+d.b
+	if d.Max != 0 && next > d.Max {
+		return d.Max
+	}
+	return next
+}
+
+func (d *FibonacciDriver) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.a, d.b = 0, 0
 }
 
 var defaultRepeaterImpl = repeaterImpl{
@@ -65,7 +352,157 @@ func NewRepeater(
 	linear time.Duration,
 	exponential float64,
 	maxRetries int) Repeater {
-	return &repeaterImpl{initial, max, linear, exponential, maxRetries}
+	return &repeaterImpl{
+		initialRepeatTime: initial,
+		maxRepeatTime:     max,
+		linearGrowth:      linear,
+		exponentialGrowth: exponential,
+		maxRetries:        maxRetries,
+	}
+}
+
+// Get a repeater like NewRepeater, but which additionally consults retryIf
+// after each failed attempt: if retryIf returns false, the repeater stops
+// retrying and returns that error immediately, regardless of maxRetries.
+// Errors wrapped with Permanent always stop retrying (unwrapped to the
+// inner error); errors wrapped with Retryable always continue retrying,
+// overriding retryIf in either case.
+func NewRepeaterWithRetryIf(
+	initial time.Duration,
+	max time.Duration,
+	linear time.Duration,
+	exponential float64,
+	maxRetries int,
+	retryIf func(error) bool) Repeater {
+	return &repeaterImpl{
+		initialRepeatTime: initial,
+		maxRepeatTime:     max,
+		linearGrowth:      linear,
+		exponentialGrowth: exponential,
+		maxRetries:        maxRetries,
+		retryIf:           retryIf,
+	}
+}
+
+// Get a repeater like NewRepeater, but which applies the given jitter
+// strategy to every computed delay. The repeater owns a *rand.Rand seeded
+// from the current time, so concurrent Repeat calls on independent
+// repeaters don't contend on the global math/rand lock.
+func NewRepeaterWithJitter(
+	initial time.Duration,
+	max time.Duration,
+	linear time.Duration,
+	exponential float64,
+	maxRetries int,
+	jitter Jitter) Repeater {
+	return NewRepeaterWithJitterAndRand(
+		initial, max, linear, exponential, maxRetries, jitter,
+		rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// Get a repeater like NewRepeaterWithJitter, but using rng instead of a
+// freshly-seeded one. Useful in tests that need deterministic jittered
+// delays.
+func NewRepeaterWithJitterAndRand(
+	initial time.Duration,
+	max time.Duration,
+	linear time.Duration,
+	exponential float64,
+	maxRetries int,
+	jitter Jitter,
+	rng *rand.Rand) Repeater {
+	return &repeaterImpl{
+		initialRepeatTime: initial,
+		maxRepeatTime:     max,
+		linearGrowth:      linear,
+		exponentialGrowth: exponential,
+		maxRetries:        maxRetries,
+		jitter:            jitter,
+		rng:               rng,
+	}
+}
+
+// Get a repeater whose delays are computed entirely by driver instead of
+// by the built-in linear/exponential formula, so callers can plug in
+// shapes (Fibonacci, constant, or a custom driver reading a Retry-After
+// header) without a dedicated constructor for each one. maxRetries works
+// as in NewRepeater: 0 retries indefinitely. opts can combine this with
+// WithClock, WithOnRetry, and WithRetryIf exactly as NewRepeaterWithOptions
+// does; WithJitter and WithRand have no effect here, since a driver-based
+// repeater never consults increaseDelay.
+func NewRepeaterFromDriver(driver BackoffDriver, max time.Duration, maxRetries int, opts ...Option) Repeater {
+	r := &repeaterImpl{
+		maxRepeatTime: max,
+		maxRetries:    maxRetries,
+		driver:        driver,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// permanentError marks an error as non-retryable. See Permanent.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so that a Repeater stops retrying immediately and
+// returns the inner error, regardless of any RetryIf predicate or
+// remaining attempts. Returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// retryableError marks an error as always retryable. See Retryable.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable wraps err so that a Repeater keeps retrying even if a RetryIf
+// predicate set on the Repeater would otherwise reject it. Returns nil if
+// err is nil.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err}
+}
+
+// classify inspects err and reports whether the repeater should stop
+// retrying, and if so, the error it should return.
+func (r *repeaterImpl) classify(err error) (stop bool, out error) {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return true, perm.err
+	}
+	var retryable *retryableError
+	if errors.As(err, &retryable) {
+		return false, nil
+	}
+	if r.retryIf != nil && !r.retryIf(err) {
+		return true, err
+	}
+	return false, nil
 }
 
 // Get a new repeater with the specified parameters that retries
@@ -79,39 +516,229 @@ func NewInfiniteRepeater(
 }
 
 func (r *repeaterImpl) Repeat(do Repeatable) error {
-	err := do()
+	return r.RepeatContext(context.Background(), do)
+}
+
+func (r *repeaterImpl) RepeatContext(ctx context.Context, do Repeatable) error {
+	return r.RepeatContextFunc(ctx, func(context.Context) error {
+		return do()
+	})
+}
+
+func (r *repeaterImpl) RepeatContextFunc(ctx context.Context, do RepeatableCtx) error {
+	if r.driver != nil {
+		return r.repeatWithDriver(ctx, do)
+	}
+
+	err := do(ctx)
 	repetitions := 0
 	if err == nil {
 		return nil
 	}
+	if stop, out := r.classify(err); stop {
+		return out
+	}
 	repetitions += 1
-	time.Sleep(r.initialRepeatTime)
-	err = do()
+	attemptNum := 1
+	firstDelay := r.firstDelay()
+	r.notifyRetry(attemptNum, err, firstDelay)
+	if sleepErr := r.sleepContext(ctx, firstDelay); sleepErr != nil {
+		return fmt.Errorf("%w (last attempt error: %v)", sleepErr, err)
+	}
+	err = do(ctx)
 	if err == nil {
 		return nil
 	}
+	if stop, out := r.classify(err); stop {
+		return out
+	}
 	if r.maxRetries == 1 {
 		return err
 	}
 
-	delay := r.initialRepeatTime
+	delay := firstDelay
 	for err != nil {
 		delay = r.increaseDelay(delay)
-		time.Sleep(delay)
-		err = do()
-		if err != nil && r.maxRetries != 0 {
-			repetitions += 1
-			if repetitions >= r.maxRetries {
-				return err
+		attemptNum += 1
+		r.notifyRetry(attemptNum, err, delay)
+		if sleepErr := r.sleepContext(ctx, delay); sleepErr != nil {
+			return fmt.Errorf("%w (last attempt error: %v)", sleepErr, err)
+		}
+		err = do(ctx)
+		if err != nil {
+			if stop, out := r.classify(err); stop {
+				return out
+			}
+			if r.maxRetries != 0 {
+				repetitions += 1
+				if repetitions >= r.maxRetries {
+					return err
+				}
 			}
 		}
 	}
 	return nil
 }
 
+// repeatWithDriver is the retry loop used when a BackoffDriver is set,
+// mirroring the repetition/maxRetries bookkeeping of the plain loop in
+// RepeatContextFunc but sourcing delays from r.driver instead of
+// increaseDelay.
+func (r *repeaterImpl) repeatWithDriver(ctx context.Context, do RepeatableCtx) error {
+	r.driver.Reset()
+	err := do(ctx)
+	if err == nil {
+		return nil
+	}
+	if stop, out := r.classify(err); stop {
+		return out
+	}
+
+	repetitions := 0
+	var prev time.Duration
+	attempt := 1
+	for err != nil {
+		delay := r.driver.Next(attempt, prev)
+		if r.maxRepeatTime != 0 && delay > r.maxRepeatTime {
+			delay = r.maxRepeatTime
+		}
+		r.notifyRetry(attempt, err, delay)
+		if sleepErr := r.sleepContext(ctx, delay); sleepErr != nil {
+			return fmt.Errorf("%w (last attempt error: %v)", sleepErr, err)
+		}
+		prev = delay
+		attempt += 1
+
+		err = do(ctx)
+		if err != nil {
+			if stop, out := r.classify(err); stop {
+				return out
+			}
+			if r.maxRetries != 0 {
+				repetitions += 1
+				if repetitions >= r.maxRetries {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// firstDelay computes the delay before the first retry. Unlike
+// increaseDelay, which grows an existing delay, this establishes the
+// starting point of the backoff curve: r.initialRepeatTime for
+// JitterNone, and that same base delay run through the configured
+// jitter strategy otherwise. Without this, the first retry would always
+// land at exactly r.initialRepeatTime regardless of jitter, which is
+// precisely the retry wave most likely to be synchronized across
+// clients.
+func (r *repeaterImpl) firstDelay() time.Duration {
+	base := r.initialRepeatTime
+	switch r.jitter {
+	case JitterFull:
+		return time.Duration(r.randFloat64() * float64(base))
+	case JitterEqual:
+		return time.Duration(float64(base)/2 + r.randFloat64()*float64(base)/2)
+	case JitterDecorrelated:
+		lo := float64(base)
+		hi := lo * 3
+		return time.Duration(math.Min(float64(r.maxRepeatTime), lo+r.randFloat64()*(hi-lo)))
+	default:
+		return base
+	}
+}
+
 func (r *repeaterImpl) increaseDelay(d time.Duration) time.Duration {
-	return time.Duration(math.Min(
+	if r.jitter == JitterDecorrelated {
+		lo := float64(r.initialRepeatTime)
+		hi := float64(d) * 3
+		if hi < lo {
+			hi = lo
+		}
+		return time.Duration(math.Min(
+			float64(r.maxRepeatTime),
+			lo+r.randFloat64()*(hi-lo)))
+	}
+
+	computed := math.Min(
 		float64(r.maxRepeatTime),
 		r.exponentialGrowth*float64(
-			d+r.linearGrowth)))
+			d+r.linearGrowth))
+	switch r.jitter {
+	case JitterFull:
+		computed = r.randFloat64() * computed
+	case JitterEqual:
+		computed = computed/2 + r.randFloat64()*(computed/2)
+	}
+	return time.Duration(computed)
+}
+
+// randFloat64 returns a float64 in [0, 1), using the repeater's own
+// *rand.Rand if one was provided, falling back to the global generator
+// otherwise.
+func (r *repeaterImpl) randFloat64() float64 {
+	if r.rng == nil {
+		return rand.Float64()
+	}
+	r.rngMu.Lock()
+	defer r.rngMu.Unlock()
+	return r.rng.Float64()
+}
+
+// RepeatValue is like Repeat, but for a fallible operation that produces a
+// result, so callers don't have to smuggle it out through a captured
+// variable. On terminal failure it returns the zero value of T alongside
+// the error Repeat would have returned.
+func RepeatValue[T any](r Repeater, fn func() (T, error)) (T, error) {
+	var result T
+	err := r.Repeat(func() error {
+		v, err := fn()
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// RepeatValueContext is like RepeatValue, but the retry loop is bound to
+// ctx as in RepeatContextFunc.
+func RepeatValueContext[T any](ctx context.Context, r Repeater, fn func(context.Context) (T, error)) (T, error) {
+	var result T
+	err := r.RepeatContextFunc(ctx, func(ctx context.Context) error {
+		v, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// sleepContext waits for d on r's Clock, returning early with ctx.Err()
+// if ctx is done before the delay elapses.
+func (r *repeaterImpl) sleepContext(ctx context.Context, d time.Duration) error {
+	clock := r.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
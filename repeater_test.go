@@ -1,7 +1,9 @@
 package repeater
 
 import (
+	"context"
 	"errors"
+	"math/rand"
 	"testing"
 	"time"
 )
@@ -126,4 +128,385 @@ func TestStopsRetryingWhenThresholdExceeded(t *testing.T) {
 	}
 }
 
-// TODO: test that repeater respects backoff logic
+func TestRepeatContextCancelledWhileWaiting(t *testing.T) {
+	repeater := &repeaterImpl{
+		initialRepeatTime: time.Hour,
+		maxRepeatTime:     time.Hour,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 1.0,
+		maxRetries:        0,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := repeater.RepeatContext(ctx, func() error {
+		return errors.New("Not ready to break yet.")
+	})
+	if err == nil {
+		t.Errorf("Expected an error; saw none")
+	} else if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error to wrap context.Canceled; saw '%v'", err)
+	}
+}
+
+func TestPermanentErrorStopsRetryingImmediately(t *testing.T) {
+	repeater := Default()
+	loop := 0
+	err := repeater.Repeat(func() error {
+		loop += 1
+		return Permanent(errors.New("won't get better with retries."))
+	})
+	if loop != 1 {
+		t.Errorf("Expected 1 loop, saw %d", loop)
+	}
+	if err == nil {
+		t.Errorf("Expected an error; saw none")
+	} else if err.Error() != "won't get better with retries." {
+		t.Errorf("Error message was wrong: saw '%s'", err.Error())
+	}
+}
+
+func TestRetryIfStopsRetryingWhenPredicateRejects(t *testing.T) {
+	repeater := NewRepeaterWithRetryIf(
+		time.Millisecond, time.Millisecond, time.Duration(0), 1.0, 10,
+		func(err error) bool { return err.Error() != "not my problem." })
+	loop := 0
+	err := repeater.Repeat(func() error {
+		loop += 1
+		return errors.New("not my problem.")
+	})
+	if loop != 1 {
+		t.Errorf("Expected 1 loop, saw %d", loop)
+	}
+	if err == nil || err.Error() != "not my problem." {
+		t.Errorf("Expected 'not my problem.'; saw '%v'", err)
+	}
+}
+
+func TestRetryableOverridesRetryIf(t *testing.T) {
+	repeater := NewRepeaterWithRetryIf(
+		time.Millisecond, time.Millisecond, time.Duration(0), 1.0, 3,
+		func(err error) bool { return false })
+	loop := 0
+	err := repeater.Repeat(func() error {
+		loop += 1
+		if loop != 3 {
+			return Retryable(errors.New("transient."))
+		}
+		return nil
+	})
+	if loop != 3 {
+		t.Errorf("Expected 3 loops, saw %d", loop)
+	}
+	if err != nil {
+		t.Errorf("Expected nil error; was %v", err)
+	}
+}
+
+func TestJitterFullStaysWithinBounds(t *testing.T) {
+	r := &repeaterImpl{
+		initialRepeatTime: 100 * time.Millisecond,
+		maxRepeatTime:     5 * time.Second,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 2.0,
+		maxRetries:        10,
+		jitter:            JitterFull,
+		rng:               rand.New(rand.NewSource(1)),
+	}
+	val := 100 * time.Millisecond
+	for i := 0; i < 5; i++ {
+		val = r.increaseDelay(val)
+		if val < 0 || val > 5*time.Second {
+			t.Errorf("JitterFull delay out of bounds: %v", val)
+		}
+	}
+}
+
+func TestJitterDecorrelatedStaysWithinBounds(t *testing.T) {
+	r := &repeaterImpl{
+		initialRepeatTime: 100 * time.Millisecond,
+		maxRepeatTime:     5 * time.Second,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 2.0,
+		maxRetries:        10,
+		jitter:            JitterDecorrelated,
+		rng:               rand.New(rand.NewSource(1)),
+	}
+	val := 100 * time.Millisecond
+	for i := 0; i < 5; i++ {
+		val = r.increaseDelay(val)
+		if val < 100*time.Millisecond || val > 5*time.Second {
+			t.Errorf("JitterDecorrelated delay out of bounds: %v", val)
+		}
+	}
+}
+
+func TestJitterFullAppliesToFirstRetry(t *testing.T) {
+	base := 100 * time.Millisecond
+	want := time.Duration(rand.New(rand.NewSource(42)).Float64() * float64(base))
+	if want == base {
+		t.Fatalf("test seed produced an unjittered sample; pick a different seed")
+	}
+
+	var delays []time.Duration
+	repeater := NewRepeaterWithOptions(
+		base, 5*time.Second, time.Duration(0), 2.0, 3,
+		WithJitter(JitterFull),
+		WithRand(rand.New(rand.NewSource(42))),
+		WithOnRetry(func(attempt int, err error, nextDelay time.Duration) {
+			delays = append(delays, nextDelay)
+		}))
+
+	loop := 0
+	err := repeater.Repeat(func() error {
+		loop += 1
+		if loop != 3 {
+			return errors.New("Not ready to break yet.")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected nil error; was %v", err)
+	}
+	if len(delays) == 0 {
+		t.Fatalf("Expected at least one retry; saw none")
+	}
+	if delays[0] == base {
+		t.Errorf("First retry delay was not jittered: saw exactly the initial delay %v", base)
+	}
+	if delays[0] != want {
+		t.Errorf("Expected first retry delay %v, saw %v", want, delays[0])
+	}
+}
+
+func TestExponentialDriver(t *testing.T) {
+	d := &ExponentialDriver{Initial: 100 * time.Millisecond, Linear: 50 * time.Millisecond, Growth: 2.0, Max: time.Second}
+	expectations := []time.Duration{
+		100 * time.Millisecond,
+		300 * time.Millisecond,
+		700 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	var prev time.Duration
+	for i, expected := range expectations {
+		prev = d.Next(i+1, prev)
+		if prev != expected {
+			t.Errorf("attempt %d: expected %v, saw %v", i+1, expected, prev)
+		}
+	}
+
+	d.Reset()
+	if first := d.Next(1, time.Hour); first != 100*time.Millisecond {
+		t.Errorf("expected attempt 1 to ignore prev and restart at Initial; saw %v", first)
+	}
+}
+
+func TestFirstDelayJitterEqualStaysWithinBounds(t *testing.T) {
+	r := &repeaterImpl{
+		initialRepeatTime: 100 * time.Millisecond,
+		maxRepeatTime:     5 * time.Second,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 2.0,
+		maxRetries:        10,
+		jitter:            JitterEqual,
+		rng:               rand.New(rand.NewSource(1)),
+	}
+	for i := 0; i < 5; i++ {
+		val := r.firstDelay()
+		if val < 50*time.Millisecond || val > 100*time.Millisecond {
+			t.Errorf("firstDelay JitterEqual out of bounds: %v", val)
+		}
+	}
+}
+
+func TestFirstDelayJitterDecorrelatedStaysWithinBounds(t *testing.T) {
+	r := &repeaterImpl{
+		initialRepeatTime: 100 * time.Millisecond,
+		maxRepeatTime:     5 * time.Second,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 2.0,
+		maxRetries:        10,
+		jitter:            JitterDecorrelated,
+		rng:               rand.New(rand.NewSource(1)),
+	}
+	for i := 0; i < 5; i++ {
+		val := r.firstDelay()
+		if val < 100*time.Millisecond || val > 5*time.Second {
+			t.Errorf("firstDelay JitterDecorrelated out of bounds: %v", val)
+		}
+	}
+}
+
+func TestFibonacciDriver(t *testing.T) {
+	d := &FibonacciDriver{Initial: 100 * time.Millisecond, Max: time.Second}
+	expectations := []time.Duration{
+		100 * time.Millisecond,
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		300 * time.Millisecond,
+		500 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+	}
+	var prev time.Duration
+	for i, expected := range expectations {
+		prev = d.Next(i+1, prev)
+		if prev != expected {
+			t.Errorf("attempt %d: expected %v, saw %v", i+1, expected, prev)
+		}
+	}
+
+	d.Reset()
+	if first := d.Next(1, 0); first != 100*time.Millisecond {
+		t.Errorf("expected Reset to restart the sequence; saw %v", first)
+	}
+}
+
+func TestNewRepeaterFromDriver(t *testing.T) {
+	repeater := NewRepeaterFromDriver(
+		&ConstantDriver{Delay: time.Millisecond}, time.Millisecond, 5)
+	loop := 0
+	err := repeater.Repeat(func() error {
+		loop += 1
+		return errors.New("This fails forever.")
+	})
+	if loop != 6 {
+		t.Errorf("Expected 6 loops, saw %d", loop)
+	}
+	if err == nil {
+		t.Errorf("Expected an error; saw none")
+	}
+}
+
+func TestRepeatValueReturnsLastSuccessfulResult(t *testing.T) {
+	repeater := Default()
+	loop := 0
+	value, err := RepeatValue(repeater, func() (int, error) {
+		loop += 1
+		if loop != 3 {
+			return 0, errors.New("Not ready to break yet.")
+		}
+		return 42, nil
+	})
+	if err != nil {
+		t.Errorf("Expected nil error; was %v", err)
+	}
+	if value != 42 {
+		t.Errorf("Expected value 42; saw %d", value)
+	}
+}
+
+func TestRepeatValueReturnsZeroValueOnTerminalFailure(t *testing.T) {
+	repeater := &repeaterImpl{
+		initialRepeatTime: time.Millisecond,
+		maxRepeatTime:     time.Millisecond,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 1.0,
+		maxRetries:        1,
+	}
+	value, err := RepeatValue(repeater, func() (int, error) {
+		return 7, errors.New("This fails forever.")
+	})
+	if err == nil {
+		t.Errorf("Expected an error; saw none")
+	}
+	if value != 0 {
+		t.Errorf("Expected zero value on failure; saw %d", value)
+	}
+}
+
+func TestRepeatValueContextReturnsLastSuccessfulResult(t *testing.T) {
+	repeater := Default()
+	loop := 0
+	value, err := RepeatValueContext(context.Background(), repeater, func(ctx context.Context) (int, error) {
+		loop += 1
+		if loop != 3 {
+			return 0, errors.New("Not ready to break yet.")
+		}
+		return 42, nil
+	})
+	if err != nil {
+		t.Errorf("Expected nil error; was %v", err)
+	}
+	if value != 42 {
+		t.Errorf("Expected value 42; saw %d", value)
+	}
+}
+
+func TestRepeatValueContextReturnsZeroValueOnTerminalFailure(t *testing.T) {
+	repeater := &repeaterImpl{
+		initialRepeatTime: time.Millisecond,
+		maxRepeatTime:     time.Millisecond,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 1.0,
+		maxRetries:        1,
+	}
+	value, err := RepeatValueContext(context.Background(), repeater, func(ctx context.Context) (int, error) {
+		return 7, errors.New("This fails forever.")
+	})
+	if err == nil {
+		t.Errorf("Expected an error; saw none")
+	}
+	if value != 0 {
+		t.Errorf("Expected zero value on failure; saw %d", value)
+	}
+}
+
+func TestRepeatValueContextCancelledWhileWaiting(t *testing.T) {
+	repeater := &repeaterImpl{
+		initialRepeatTime: time.Hour,
+		maxRepeatTime:     time.Hour,
+		linearGrowth:      time.Duration(0),
+		exponentialGrowth: 1.0,
+		maxRetries:        0,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	value, err := RepeatValueContext(ctx, repeater, func(ctx context.Context) (int, error) {
+		return 7, errors.New("Not ready to break yet.")
+	})
+	if err == nil {
+		t.Errorf("Expected an error; saw none")
+	} else if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error to wrap context.Canceled; saw '%v'", err)
+	}
+	if value != 0 {
+		t.Errorf("Expected zero value when cancelled; saw %d", value)
+	}
+}
+
+func TestOnRetryCalledOncePerRetry(t *testing.T) {
+	var seen []int
+	repeater := NewRepeaterWithOptions(
+		time.Millisecond, time.Millisecond, time.Duration(0), 1.0, 10,
+		WithOnRetry(func(attempt int, err error, nextDelay time.Duration) {
+			seen = append(seen, attempt)
+		}))
+	loop := 0
+	err := repeater.Repeat(func() error {
+		loop += 1
+		if loop != 3 {
+			return errors.New("Not ready to break yet.")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected nil error; was %v", err)
+	}
+	if want := []int{1, 2}; len(seen) != len(want) || seen[0] != want[0] || seen[1] != want[1] {
+		t.Errorf("Expected attempts %v; saw %v", want, seen)
+	}
+}
+
+func TestWithJitterAutoSeedsRandWhenNoRandGiven(t *testing.T) {
+	repeater := NewRepeaterWithOptions(
+		time.Millisecond, time.Millisecond, time.Duration(0), 1.0, 10,
+		WithJitter(JitterFull))
+	r, ok := repeater.(*repeaterImpl)
+	if !ok {
+		t.Fatalf("Expected *repeaterImpl; saw %T", repeater)
+	}
+	if r.rng == nil {
+		t.Errorf("Expected WithJitter to auto-seed a *rand.Rand when no WithRand was given")
+	}
+}
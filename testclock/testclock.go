@@ -0,0 +1,67 @@
+// Package testclock provides a deterministic repeater.Clock for tests.
+package testclock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fixermark/repeater"
+)
+
+// FakeClock is a repeater.Clock that never actually waits: Sleep and the
+// timers it hands out via NewTimer fire immediately, while still
+// recording every requested delay so a test can assert on the exact
+// backoff sequence a Repeater produced.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	delays []time.Duration
+}
+
+// NewFakeClock returns a FakeClock whose Now starts at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delays = append(c.delays, d)
+	c.now = c.now.Add(d)
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) repeater.Timer {
+	c.mu.Lock()
+	c.delays = append(c.delays, d)
+	c.now = c.now.Add(d)
+	fired := c.now
+	c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	ch <- fired
+	return &fakeTimer{ch: ch}
+}
+
+// Delays returns the sequence of delays requested via Sleep or NewTimer
+// so far, in order.
+func (c *FakeClock) Delays() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]time.Duration, len(c.delays))
+	copy(out, c.delays)
+	return out
+}
+
+type fakeTimer struct {
+	ch chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool { return true }